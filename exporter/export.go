@@ -0,0 +1,46 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+// Package exporter serves the metrics collected by mtail programs over
+// HTTP, in the formats expected by various monitoring systems.
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/google/mtail/metrics"
+)
+
+// Options configures the set of metrics an Exporter serves and how it
+// identifies itself to scrapers.
+type Options struct {
+	Store    *metrics.Store
+	Hostname string
+
+	// OmitInstanceLabel suppresses the `instance` label on Prometheus
+	// scrapes. Prometheus already attaches an `instance` label derived
+	// from the scrape target, so exporting our own can be redundant or
+	// actively confusing; operators that rely on Prometheus's label can
+	// set this to avoid the duplicate.
+	OmitInstanceLabel bool
+}
+
+// Exporter manages the export of metrics to passive or active collectors.
+type Exporter struct {
+	store    *metrics.Store
+	hostname string
+
+	omitInstanceLabel bool
+}
+
+// New creates a new Exporter from the given Options.
+func New(o Options) (*Exporter, error) {
+	if o.Store == nil {
+		return nil, fmt.Errorf("exporter needs a metric store")
+	}
+	return &Exporter{
+		store:             o.Store,
+		hostname:          o.Hostname,
+		omitInstanceLabel: o.OmitInstanceLabel,
+	}, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/mtail/metrics"
+)
+
+// HandlePrometheus exports the current state of all metrics in the
+// Prometheus text exposition format, so a Prometheus server can scrape
+// this handler directly, typically mounted at /metrics.
+func (e *Exporter) HandlePrometheus(w http.ResponseWriter, r *http.Request) {
+	e.store.Range(func(m *metrics.Metric) {
+		if help := helpText(m); help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", m.Name, help)
+		}
+		if unit := m.Attrs["unit"]; unit != "" {
+			fmt.Fprintf(w, "# UNIT %s %s\n", m.Name, unit)
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.Name, m.Kind)
+		for _, lv := range m.LabelValues {
+			labels := e.prometheusLabels(m, lv)
+			switch m.Kind {
+			case metrics.Histogram:
+				ts := lv.Dist.Time.UnixNano() / 1e6
+				for i := 0; i <= len(m.Buckets); i++ {
+					fmt.Fprintf(w, "%s_bucket{%sle=%q} %d %d\n", m.Name, labelPrefix(labels), formatBound(m.Buckets, i), bucketCount(lv.Dist, i), ts)
+				}
+				fmt.Fprintf(w, "%s_sum{%s} %s %d\n", m.Name, labels, formatFloat(lv.Dist.Sum), ts)
+				fmt.Fprintf(w, "%s_count{%s} %d %d\n", m.Name, labels, lv.Dist.Count, ts)
+			case metrics.Summary:
+				ts := lv.Dist.Time.UnixNano() / 1e6
+				for i, q := range m.Buckets {
+					fmt.Fprintf(w, "%s{%squantile=%q} %s %d\n", m.Name, labelPrefix(labels), formatFloat(q), formatFloat(lv.Dist.Quantiles[i]), ts)
+				}
+				fmt.Fprintf(w, "%s_sum{%s} %s %d\n", m.Name, labels, formatFloat(lv.Dist.Sum), ts)
+				fmt.Fprintf(w, "%s_count{%s} %d %d\n", m.Name, labels, lv.Dist.Count, ts)
+			default:
+				fmt.Fprintf(w, "%s{%s} %d %d\n", m.Name, labels, lv.Value.Value, lv.Value.Time.UnixNano()/1e6)
+			}
+		}
+	})
+}
+
+// helpText returns the metric's operator-facing description: its
+// HelpText field if set, falling back to a `@help(...)` attribute so
+// that metrics documented only via attributes still get a HELP line.
+func helpText(m *metrics.Metric) string {
+	if m.HelpText != "" {
+		return m.HelpText
+	}
+	return m.Attrs["help"]
+}
+
+// labelPrefix returns labels with a trailing comma, ready to be followed
+// by another label=value pair, or the empty string if there are none.
+func labelPrefix(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return labels + ","
+}
+
+// prometheusLabels renders the dimensioned labels, program, and
+// (optionally) instance for a metric's LabelValue as quoted
+// `key="value"` pairs, as required by the Prometheus text format.
+func (e *Exporter) prometheusLabels(m *metrics.Metric, lv *metrics.LabelValue) string {
+	parts := make([]string, 0, len(m.Keys)+2)
+	for i, k := range m.Keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, lv.Labels[i]))
+	}
+	parts = append(parts, fmt.Sprintf("prog=%q", m.Program))
+	if !e.omitInstanceLabel {
+		parts = append(parts, fmt.Sprintf("instance=%q", e.hostname))
+	}
+	return strings.Join(parts, ",")
+}
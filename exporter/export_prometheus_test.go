@@ -0,0 +1,192 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package exporter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/mtail/metrics"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var ts = time.Date(2014, time.April, 16, 21, 6, 35, 0, time.UTC)
+
+var handlePrometheusTests = []struct {
+	name         string
+	metrics      []*metrics.Metric
+	omitInstance bool
+	expected     string
+}{
+	{"empty",
+		[]*metrics.Metric{},
+		false,
+		"",
+	},
+	{"single",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:        "foo",
+				Program:     "test",
+				Kind:        metrics.Counter,
+				HelpText:    "Total number of foos.",
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{}, Value: &metrics.Datum{Value: 1, Time: ts}}},
+			},
+		},
+		false,
+		`# HELP foo Total number of foos.
+# TYPE foo counter
+foo{prog="test",instance="gunstar"} 1 1397682395000
+`,
+	},
+	{"dimensioned",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:        "foo",
+				Program:     "test",
+				Kind:        metrics.Gauge,
+				Keys:        []string{"a", "b"},
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{"1", "2"}, Value: &metrics.Datum{Value: 1, Time: ts}}},
+			},
+		},
+		false,
+		`# TYPE foo gauge
+foo{a="1",b="2",prog="test",instance="gunstar"} 1 1397682395000
+`,
+	},
+	{"multi-program",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:        "foo",
+				Program:     "test2",
+				Kind:        metrics.Counter,
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{}, Value: &metrics.Datum{Value: 2, Time: ts}}},
+			},
+			&metrics.Metric{
+				Name:        "foo",
+				Program:     "test1",
+				Kind:        metrics.Counter,
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{}, Value: &metrics.Datum{Value: 1, Time: ts}}},
+			},
+		},
+		false,
+		`# TYPE foo counter
+foo{prog="test1",instance="gunstar"} 1 1397682395000
+# TYPE foo counter
+foo{prog="test2",instance="gunstar"} 2 1397682395000
+`,
+	},
+	{"omitted instance label",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:        "foo",
+				Program:     "test",
+				Kind:        metrics.Counter,
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{}, Value: &metrics.Datum{Value: 1, Time: ts}}},
+			},
+		},
+		true,
+		`# TYPE foo counter
+foo{prog="test"} 1 1397682395000
+`,
+	},
+	{"documented via attributes",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:        "foo",
+				Program:     "test",
+				Kind:        metrics.Counter,
+				Attrs:       map[string]string{"help": "Total number of foos.", "unit": "seconds"},
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{}, Value: &metrics.Datum{Value: 1, Time: ts}}},
+			},
+		},
+		false,
+		`# HELP foo Total number of foos.
+# UNIT foo seconds
+# TYPE foo counter
+foo{prog="test",instance="gunstar"} 1 1397682395000
+`,
+	},
+	{"dimensioned histogram",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:    "foo",
+				Program: "test",
+				Kind:    metrics.Histogram,
+				Keys:    []string{"a"},
+				Buckets: []float64{1, 5, 10},
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{"1"}, Dist: &metrics.Distribution{
+					BucketCounts: []int64{2, 3, 3},
+					Sum:          12,
+					Count:        3,
+					Time:         ts,
+				}}},
+			},
+		},
+		false,
+		`# TYPE foo histogram
+foo_bucket{a="1",prog="test",instance="gunstar",le="1"} 2 1397682395000
+foo_bucket{a="1",prog="test",instance="gunstar",le="5"} 3 1397682395000
+foo_bucket{a="1",prog="test",instance="gunstar",le="10"} 3 1397682395000
+foo_bucket{a="1",prog="test",instance="gunstar",le="+Inf"} 3 1397682395000
+foo_sum{a="1",prog="test",instance="gunstar"} 12 1397682395000
+foo_count{a="1",prog="test",instance="gunstar"} 3 1397682395000
+`,
+	},
+	{"summary",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:    "foo",
+				Program: "test",
+				Kind:    metrics.Summary,
+				Keys:    []string{"a"},
+				Buckets: []float64{0.5, 0.9, 0.99},
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{"1"}, Dist: &metrics.Distribution{
+					Quantiles: []float64{1, 5, 10},
+					Sum:       12,
+					Count:     3,
+					Time:      ts,
+				}}},
+			},
+		},
+		false,
+		`# TYPE foo summary
+foo{a="1",prog="test",instance="gunstar",quantile="0.5"} 1 1397682395000
+foo{a="1",prog="test",instance="gunstar",quantile="0.9"} 5 1397682395000
+foo{a="1",prog="test",instance="gunstar",quantile="0.99"} 10 1397682395000
+foo_sum{a="1",prog="test",instance="gunstar"} 12 1397682395000
+foo_count{a="1",prog="test",instance="gunstar"} 3 1397682395000
+`,
+	},
+}
+
+func TestHandlePrometheus(t *testing.T) {
+	for _, tc := range handlePrometheusTests {
+		ms := metrics.Store{}
+		for _, metric := range tc.metrics {
+			ms.Add(metric)
+		}
+		o := Options{Store: &ms, Hostname: "gunstar", OmitInstanceLabel: tc.omitInstance}
+		e, err := New(o)
+		if err != nil {
+			t.Fatalf("couldn't make exporter: %s", err)
+		}
+		response := httptest.NewRecorder()
+		e.HandlePrometheus(response, &http.Request{})
+		if response.Code != 200 {
+			t.Errorf("test case %s: response code not 200: %d", tc.name, response.Code)
+		}
+		b, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Errorf("test case %s: failed to read response: %s", tc.name, err)
+		}
+		diff := pretty.Compare(string(b), tc.expected)
+		if len(diff) > 0 {
+			t.Errorf("test case %s: response not expected:\n%s", tc.name, diff)
+		}
+	}
+}
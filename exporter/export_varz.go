@@ -0,0 +1,74 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/mtail/metrics"
+)
+
+// HandleVarz exports the current state of all metrics in the simple
+// name{labels} value format used by the Google /varz convention.
+func (e *Exporter) HandleVarz(w http.ResponseWriter, r *http.Request) {
+	e.store.Range(func(m *metrics.Metric) {
+		for _, lv := range m.LabelValues {
+			labels := e.varzLabels(m, lv)
+			switch m.Kind {
+			case metrics.Histogram:
+				for i := 0; i <= len(m.Buckets); i++ {
+					fmt.Fprintf(w, "%s_bucket{le=%s,%s} %d\n", m.Name, formatBound(m.Buckets, i), labels, bucketCount(lv.Dist, i))
+				}
+				fmt.Fprintf(w, "%s_sum{%s} %s\n", m.Name, labels, formatFloat(lv.Dist.Sum))
+				fmt.Fprintf(w, "%s_count{%s} %d\n", m.Name, labels, lv.Dist.Count)
+			case metrics.Summary:
+				for i, q := range m.Buckets {
+					fmt.Fprintf(w, "%s{quantile=%s,%s} %s\n", m.Name, formatFloat(q), labels, formatFloat(lv.Dist.Quantiles[i]))
+				}
+				fmt.Fprintf(w, "%s_sum{%s} %s\n", m.Name, labels, formatFloat(lv.Dist.Sum))
+				fmt.Fprintf(w, "%s_count{%s} %d\n", m.Name, labels, lv.Dist.Count)
+			default:
+				fmt.Fprintf(w, "%s{%s} %d\n", m.Name, labels, lv.Value.Value)
+			}
+		}
+	})
+}
+
+// formatBound renders the upper bound of the i'th histogram bucket,
+// which is the final, implicit +Inf bucket once i reaches len(bounds).
+func formatBound(bounds []float64, i int) string {
+	if i >= len(bounds) {
+		return "+Inf"
+	}
+	return formatFloat(bounds[i])
+}
+
+// bucketCount returns the cumulative observation count for the i'th
+// histogram bucket, which is dist.Count itself for the final, implicit
+// +Inf bucket once i reaches len(dist.BucketCounts).
+func bucketCount(dist *metrics.Distribution, i int) int64 {
+	if i >= len(dist.BucketCounts) {
+		return dist.Count
+	}
+	return dist.BucketCounts[i]
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// varzLabels renders the dimensioned labels, program, and instance for a
+// metric's LabelValue as unquoted `key=value` pairs.
+func (e *Exporter) varzLabels(m *metrics.Metric, lv *metrics.LabelValue) string {
+	parts := make([]string, 0, len(m.Keys)+2)
+	for i, k := range m.Keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, lv.Labels[i]))
+	}
+	parts = append(parts, fmt.Sprintf("prog=%s", m.Program))
+	parts = append(parts, fmt.Sprintf("instance=%s", e.hostname))
+	return strings.Join(parts, ",")
+}
@@ -45,6 +45,51 @@ var handleVarzTests = []struct {
 			},
 		},
 		`foo{a=1,b=2,prog=test,instance=gunstar} 1
+`,
+	},
+	{"dimensioned histogram",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:    "foo",
+				Program: "test",
+				Kind:    metrics.Histogram,
+				Keys:    []string{"a"},
+				Buckets: []float64{1, 5, 10},
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{"1"}, Dist: &metrics.Distribution{
+					BucketCounts: []int64{2, 3, 3},
+					Sum:          12,
+					Count:        3,
+				}}},
+			},
+		},
+		`foo_bucket{le=1,a=1,prog=test,instance=gunstar} 2
+foo_bucket{le=5,a=1,prog=test,instance=gunstar} 3
+foo_bucket{le=10,a=1,prog=test,instance=gunstar} 3
+foo_bucket{le=+Inf,a=1,prog=test,instance=gunstar} 3
+foo_sum{a=1,prog=test,instance=gunstar} 12
+foo_count{a=1,prog=test,instance=gunstar} 3
+`,
+	},
+	{"summary",
+		[]*metrics.Metric{
+			&metrics.Metric{
+				Name:    "foo",
+				Program: "test",
+				Kind:    metrics.Summary,
+				Keys:    []string{"a"},
+				Buckets: []float64{0.5, 0.9, 0.99},
+				LabelValues: []*metrics.LabelValue{&metrics.LabelValue{Labels: []string{"1"}, Dist: &metrics.Distribution{
+					Quantiles: []float64{1, 5, 10},
+					Sum:       12,
+					Count:     3,
+				}}},
+			},
+		},
+		`foo{quantile=0.5,a=1,prog=test,instance=gunstar} 1
+foo{quantile=0.9,a=1,prog=test,instance=gunstar} 5
+foo{quantile=0.99,a=1,prog=test,instance=gunstar} 10
+foo_sum{a=1,prog=test,instance=gunstar} 12
+foo_count{a=1,prog=test,instance=gunstar} 3
 `,
 	},
 }
@@ -55,7 +100,7 @@ func TestHandleVarz(t *testing.T) {
 		for _, metric := range tc.metrics {
 			ms.Add(metric)
 		}
-		o := Options{&ms, "gunstar"}
+		o := Options{Store: &ms, Hostname: "gunstar"}
 		e, err := New(o)
 		if err != nil {
 			t.Fatalf("couldn't make exporter: %s", err)
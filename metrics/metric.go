@@ -0,0 +1,105 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+// Package metrics provides storage for the metric objects created and
+// updated by mtail programs, and the data types for those metrics.
+package metrics
+
+import "time"
+
+// Kind describes the type of a Metric.
+type Kind int
+
+const (
+	// Counter is a monotonically increasing metric.
+	Counter Kind = iota
+	// Gauge is a metric that can increase or decrease.
+	Gauge
+	// Histogram is a metric that counts observations into cumulative
+	// buckets.
+	Histogram
+	// Summary is a metric that reports quantiles of observations.
+	Summary
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	case Histogram:
+		return "histogram"
+	case Summary:
+		return "summary"
+	}
+	return "unknown"
+}
+
+// Datum is a single observation of a Counter or Gauge metric: a value
+// and the time it was recorded.
+type Datum struct {
+	Value int64
+	Time  time.Time
+}
+
+// Distribution is the accumulated state of a Histogram or Summary
+// LabelValue. For a Histogram, BucketCounts holds the cumulative count
+// of observations at or below each upper bound in the owning Metric's
+// Buckets, with an implicit final +Inf bucket equal to Count. For a
+// Summary, Quantiles holds the most recently computed value for each
+// quantile in Buckets, in the same order. Both kinds track the running
+// Sum and Count of all observations.
+type Distribution struct {
+	BucketCounts []int64
+	Quantiles    []float64
+	Sum          float64
+	Count        int64
+	Time         time.Time
+}
+
+// LabelValue binds an observation to the particular set of label values
+// that produced it. Labels is positionally matched against the owning
+// Metric's Keys. Value holds the observation for a Counter or Gauge;
+// Dist holds it for a Histogram or Summary.
+type LabelValue struct {
+	Labels []string
+	Value  *Datum
+	Dist   *Distribution
+}
+
+// Metric describes a named, typed measurement exported by an mtail
+// program, along with the set of observations recorded for each distinct
+// combination of its label values.
+type Metric struct {
+	Name        string
+	Program     string
+	Kind        Kind
+	Keys        []string
+	LabelValues []*LabelValue
+
+	// Buckets holds the histogram bucket upper bounds, or the summary
+	// quantiles, declared for this metric. It is unused for Counter and
+	// Gauge metrics.
+	Buckets []float64
+
+	// HelpText is an operator-facing description of the metric, surfaced
+	// in exporters that support it (e.g. the Prometheus HELP line).
+	HelpText string
+
+	// Attrs holds the metric's declared attributes (e.g. `@unit("seconds")`)
+	// keyed by attribute name, for exporters that want to surface more
+	// than HelpText. A `help` attribute is equivalent to HelpText and is
+	// used as a fallback wherever HelpText is empty.
+	Attrs map[string]string
+}
+
+// SetAttr records a parsed metric attribute, such as a `@help(...)` or
+// `@unit(...)` decorator applied to this metric's declaration,
+// initializing Attrs if this is the first one.
+func (m *Metric) SetAttr(name, value string) {
+	if m.Attrs == nil {
+		m.Attrs = make(map[string]string)
+	}
+	m.Attrs[name] = value
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// Store is the central registry of metrics created by running mtail
+// programs. It is safe for concurrent use.
+type Store struct {
+	mu sync.RWMutex
+	// Metrics is keyed by metric name; more than one program may export a
+	// metric of the same name, so each name maps to a slice.
+	Metrics map[string][]*Metric
+}
+
+// Add registers a new metric with the Store.
+func (s *Store) Add(m *Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Metrics == nil {
+		s.Metrics = make(map[string][]*Metric)
+	}
+	s.Metrics[m.Name] = append(s.Metrics[m.Name], m)
+}
+
+// Range calls f for every metric in the Store, visiting metric names in
+// lexical order and, within a name, programs in lexical order. The
+// stable order lets callers like the exporters produce deterministic
+// output.
+func (s *Store) Range(f func(*Metric)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.Metrics))
+	for name := range s.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ms := append([]*Metric(nil), s.Metrics[name]...)
+		sort.Slice(ms, func(i, j int) bool { return ms[i].Program < ms[j].Program })
+		for _, m := range ms {
+			f(m)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package vm
+
+import "fmt"
+
+// lexError is a single lexical error, tied to the position of the
+// input that caused it.
+type lexError struct {
+	pos position
+	msg string
+}
+
+func (e *lexError) Error() string {
+	return fmt.Sprintf("%s: %s", e.pos, e.msg)
+}
+
+// errorList accumulates every lexError encountered while scanning an
+// input, so a single pass can report more than one problem with it.
+type errorList []*lexError
+
+func (l *errorList) add(pos position, msg string) {
+	*l = append(*l, &lexError{pos, msg})
+}
@@ -0,0 +1,667 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package vm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// lexer turns mtail program source into a stream of tokens, pulled one
+// at a time via nextToken. Lexical errors don't stop the scan: nextToken
+// skips past the offending input and keeps going, recording each error
+// into errs so that many can be reported from one pass.
+type lexer struct {
+	name  string
+	input []rune
+
+	pos int // index of the next rune to read
+
+	fset *FileSet
+	file *File
+	errs errorList
+
+	// keepComments makes nextToken emit COMMENT tokens for `#`-line and
+	// `/* */` block comments instead of silently skipping over them, so
+	// a parser can associate a leading comment with the declaration that
+	// follows it.
+	keepComments bool
+
+	// inHistogramHeader is true while scanning the single line that
+	// starts with a `histogram` keyword, so that "buckets" on that line
+	// lexes as BUCKETS rather than ID. It is cleared as soon as a
+	// newline is skipped, since a declaration header never spans lines.
+	inHistogramHeader bool
+}
+
+// newLexer creates a lexer for the named input, reading all of r eagerly.
+func newLexer(name string, r io.Reader) *lexer {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		// newLexer has no error return and does not record an I/O error
+		// anywhere: the error is dropped, along with any partial input,
+		// and the lexer scans an empty input.
+		b = nil
+	}
+	input := []rune(string(b))
+	fset := newFileSet()
+	return &lexer{name: name, input: input, fset: fset, file: fset.AddFile(name, len(input))}
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isOctalDigit(r rune) bool {
+	return r >= '0' && r <= '7'
+}
+
+func isBinaryDigit(r rune) bool {
+	return r == '0' || r == '1'
+}
+
+// hexDigitValue returns the numeric value of a hex digit rune and
+// whether r is one.
+func hexDigitValue(r rune) (int, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0'), true
+	case r >= 'a' && r <= 'f':
+		return int(r-'a') + 10, true
+	case r >= 'A' && r <= 'F':
+		return int(r-'A') + 10, true
+	}
+	return 0, false
+}
+
+func isHexDigit(r rune) bool {
+	_, ok := hexDigitValue(r)
+	return ok
+}
+
+func isAlpha(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isIdentStart(r rune) bool {
+	return isAlpha(r)
+}
+
+func isIdentCont(r rune) bool {
+	return isAlpha(r) || isDigit(r) || r == '-'
+}
+
+// peek returns the rune at the current position without consuming it, or
+// -1 at end of input.
+func (l *lexer) peek() rune {
+	if l.pos >= len(l.input) {
+		return -1
+	}
+	return l.input[l.pos]
+}
+
+// peekAt returns the rune offset runes ahead of the current position, or
+// -1 if that is past the end of input.
+func (l *lexer) peekAt(offset int) rune {
+	if l.pos+offset >= len(l.input) {
+		return -1
+	}
+	return l.input[l.pos+offset]
+}
+
+// advance consumes and returns the rune at the current position,
+// recording line boundaries in the lexer's File as it goes.
+func (l *lexer) advance() rune {
+	r := l.input[l.pos]
+	l.pos++
+	if r == '\n' {
+		l.file.addLine(l.pos)
+	}
+	return r
+}
+
+func (l *lexer) token(kind tokenKind, text string, start, end int) token {
+	return token{kind, text, l.fset.Position(l.file.Pos(start), l.file.Pos(end))}
+}
+
+// skipWhitespace advances past spaces, tabs, newlines, and carriage
+// returns. Crossing a newline ends any histogram declaration header in
+// progress, since one never spans multiple lines.
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.input) {
+		switch l.peek() {
+		case '\n':
+			l.inHistogramHeader = false
+			l.advance()
+		case ' ', '\t', '\r':
+			l.advance()
+		default:
+			return
+		}
+	}
+}
+
+// nextToken scans and returns the next token in the input. A malformed
+// token never reaches the caller: it is recorded in errs and nextToken
+// skips past it to keep scanning, so a single pass over malformed input
+// can surface every error in it rather than just the first. Once it
+// returns an EOF token, subsequent calls keep returning EOF.
+func (l *lexer) nextToken() token {
+	for {
+		tok := l.scan()
+		if tok.kind != INVALID {
+			return tok
+		}
+		l.errs.add(tok.pos, tok.text)
+	}
+}
+
+// scan scans and returns the single next token in the input, which may
+// be an INVALID token describing a lexical error at the current
+// position.
+func (l *lexer) scan() token {
+	for {
+		l.skipWhitespace()
+		if l.pos >= len(l.input) {
+			break
+		}
+		if l.peek() == '#' {
+			tok := l.lexLineComment(l.pos)
+			if !l.keepComments {
+				continue
+			}
+			return tok
+		}
+		// A block comment takes priority over a regex literal whenever a
+		// '/' is immediately followed by '*': only the position right
+		// after a '/' that starts a new token is ever checked this way,
+		// so '*/' or '/*' occurring inside an already-started regex is
+		// just ordinary regex text and never reaches this check. This
+		// means a regex literal starting with a literal '*', like
+		// `/*abc/`, is lexed as a block comment instead of a REGEX
+		// token; that's an acceptable tradeoff since RE2 rejects a
+		// leading '*' as a dangling repetition operator anyway, so such
+		// a literal was never going to compile as a regex either way.
+		if l.peek() == '/' && l.peekAt(1) == '*' {
+			tok := l.lexBlockComment(l.pos)
+			if !l.keepComments && tok.kind != INVALID {
+				continue
+			}
+			return tok
+		}
+		break
+	}
+
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return l.token(EOF, "", start, start)
+	}
+
+	r := l.advance()
+	switch r {
+	case '{':
+		return l.token(LCURLY, "{", start, start)
+	case '}':
+		return l.token(RCURLY, "}", start, start)
+	case '(':
+		return l.token(LPAREN, "(", start, start)
+	case ')':
+		return l.token(RPAREN, ")", start, start)
+	case '[':
+		return l.token(LSQUARE, "[", start, start)
+	case ']':
+		return l.token(RSQUARE, "]", start, start)
+	case ',':
+		return l.token(COMMA, ",", start, start)
+	case '+':
+		if l.peek() == '+' {
+			l.advance()
+			return l.token(INC, "++", start, l.pos-1)
+		}
+		if l.peek() == '=' {
+			l.advance()
+			return l.token(ADD_ASSIGN, "+=", start, l.pos-1)
+		}
+		return l.token(PLUS, "+", start, start)
+	case '-':
+		return l.token(MINUS, "-", start, start)
+	case '=':
+		if l.peek() == '=' {
+			l.advance()
+			return l.token(EQ, "==", start, l.pos-1)
+		}
+		return l.token(ASSIGN, "=", start, start)
+	case '<':
+		if l.peek() == '=' {
+			l.advance()
+			return l.token(LE, "<=", start, l.pos-1)
+		}
+		return l.token(LT, "<", start, start)
+	case '>':
+		if l.peek() == '=' {
+			l.advance()
+			return l.token(GE, ">=", start, l.pos-1)
+		}
+		return l.token(GT, ">", start, start)
+	case '!':
+		if l.peek() == '=' {
+			l.advance()
+			return l.token(NE, "!=", start, l.pos-1)
+		}
+		return l.invalid(fmt.Sprintf("Unexpected input: '%c'", r), start, start)
+	case '$':
+		return l.lexCapref(start)
+	case '"':
+		return l.lexString(start)
+	case '/':
+		return l.lexRegex(start)
+	case '@':
+		return l.lexDecorator(start)
+	case '.':
+		if isDigit(l.peek()) {
+			return l.lexFloatFraction(start)
+		}
+		return l.invalid(fmt.Sprintf("Unexpected input: '%c'", r), start, start)
+	}
+
+	switch {
+	case isDigit(r):
+		return l.lexNumeric(start)
+	case isIdentStart(r):
+		return l.lexIdentifier(start)
+	}
+
+	return l.invalid(fmt.Sprintf("Unexpected input: '%c'", r), start, start)
+}
+
+func (l *lexer) invalid(msg string, start, end int) token {
+	return l.token(INVALID, msg, start, end)
+}
+
+// lexNumeric scans a numeric literal beginning at start, where
+// input[start] has already been consumed as an ordinary decimal digit.
+// It returns a NUMERIC token for integers (including hex, octal, and
+// binary literals) or a FLOAT token if a fractional part or exponent is
+// present.
+func (l *lexer) lexNumeric(start int) token {
+	if l.input[start] == '0' {
+		switch l.peek() {
+		case 'x', 'X':
+			return l.lexRadixInt(start, "hex", isHexDigit)
+		case 'o', 'O':
+			return l.lexRadixInt(start, "octal", isOctalDigit)
+		case 'b', 'B':
+			return l.lexRadixInt(start, "binary", isBinaryDigit)
+		}
+	}
+
+	l.consumeDigits()
+	isFloat := false
+	if l.peek() == '.' {
+		isFloat = true
+		l.advance()
+		l.consumeDigits()
+	}
+	if l.lexExponent() {
+		isFloat = true
+	}
+	if isFloat {
+		return l.token(FLOAT, string(l.input[start:l.pos]), start, l.pos-1)
+	}
+	return l.token(NUMERIC, string(l.input[start:l.pos]), start, l.pos-1)
+}
+
+// lexFloatFraction scans a float literal that begins with a '.', e.g.
+// ".25", where the '.' at input[start] has already been consumed and
+// the following rune is known to be a digit.
+func (l *lexer) lexFloatFraction(start int) token {
+	l.consumeDigits()
+	l.lexExponent()
+	return l.token(FLOAT, string(l.input[start:l.pos]), start, l.pos-1)
+}
+
+// consumeDigits advances over a run of decimal digits, allowing `_` as a
+// digit-group separator.
+func (l *lexer) consumeDigits() {
+	for isDigit(l.peek()) || l.peek() == '_' {
+		l.advance()
+	}
+}
+
+// lexExponent consumes a `[eE][+-]?[0-9][0-9_]*` exponent suffix if one is
+// present, reporting whether it found one.
+func (l *lexer) lexExponent() bool {
+	if l.peek() != 'e' && l.peek() != 'E' {
+		return false
+	}
+	offset := 1
+	if l.peekAt(1) == '+' || l.peekAt(1) == '-' {
+		offset = 2
+	}
+	if !isDigit(l.peekAt(offset)) {
+		return false
+	}
+	l.advance() // e/E
+	if l.peek() == '+' || l.peek() == '-' {
+		l.advance()
+	}
+	l.consumeDigits()
+	return true
+}
+
+// lexRadixInt scans a prefixed integer literal such as 0x1f, 0o17, or
+// 0b1010. input[start] is the leading '0'; the peeked rune is the radix
+// marker (x/o/b), not yet consumed.
+func (l *lexer) lexRadixInt(start int, radixName string, isRadixDigit func(rune) bool) token {
+	l.advance() // radix marker
+	digitsStart := l.pos
+	for isRadixDigit(l.peek()) || l.peek() == '_' {
+		l.advance()
+	}
+	if l.pos == digitsStart {
+		return l.invalid(
+			fmt.Sprintf("Invalid %s literal: %s", radixName, string(l.input[start:l.pos])),
+			start, l.pos-1)
+	}
+	return l.token(NUMERIC, string(l.input[start:l.pos]), start, l.pos-1)
+}
+
+func (l *lexer) lexIdentifier(start int) token {
+	for isIdentCont(l.peek()) {
+		l.advance()
+	}
+	text := string(l.input[start:l.pos])
+	if kind, ok := keywords[text]; ok {
+		if kind == BUCKETS && !l.inHistogramHeader {
+			return l.token(ID, text, start, l.pos-1)
+		}
+		if kind == HISTOGRAM {
+			l.inHistogramHeader = true
+		}
+		return l.token(kind, text, start, l.pos-1)
+	}
+	if builtins[text] {
+		return l.token(BUILTIN, text, start, l.pos-1)
+	}
+	return l.token(ID, text, start, l.pos-1)
+}
+
+func (l *lexer) lexCapref(start int) token {
+	nameStart := l.pos
+	if isDigit(l.peek()) {
+		for isDigit(l.peek()) {
+			l.advance()
+		}
+	} else {
+		for isAlpha(l.peek()) || isDigit(l.peek()) {
+			l.advance()
+		}
+	}
+	return l.token(CAPREF, string(l.input[nameStart:l.pos]), start, l.pos-1)
+}
+
+// lexDecorator scans the text following an '@' already consumed by the
+// caller. A bare name like `@foo` is a DECO token; a name immediately
+// followed by `(...)`, like `@help("bytes transferred")`, is a metric
+// attribute and produces an ATTRIBUTE token instead.
+func (l *lexer) lexDecorator(start int) token {
+	nameStart := l.pos
+	for isIdentCont(l.peek()) {
+		l.advance()
+	}
+	if l.peek() != '(' {
+		return l.token(DECO, string(l.input[nameStart:l.pos]), start, l.pos-1)
+	}
+	return l.lexAttribute(start, nameStart)
+}
+
+// lexAttribute scans an attribute's parenthesized argument list,
+// starting at the unconsumed '(' following the attribute name at
+// nameStart. Parens and quoted strings nest/balance correctly, so
+// commas and parens inside a quoted argument don't end the attribute
+// early; the returned token's text is the name and argument list, e.g.
+// "help(\"bytes transferred\")".
+func (l *lexer) lexAttribute(start, nameStart int) token {
+	depth := 0
+	for {
+		if l.pos >= len(l.input) || l.peek() == '\n' {
+			return l.invalid(
+				fmt.Sprintf("Unterminated attribute: %s", strconv.Quote(string(l.input[start:l.pos]))),
+				start, l.pos-1)
+		}
+		r := l.advance()
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return l.token(ATTRIBUTE, string(l.input[nameStart:l.pos]), start, l.pos-1)
+			}
+		case '"':
+			if !l.skipAttributeString() {
+				return l.invalid(
+					fmt.Sprintf("Unterminated attribute: %s", strconv.Quote(string(l.input[start:l.pos]))),
+					start, l.pos-1)
+			}
+		}
+	}
+}
+
+// skipAttributeString consumes a quoted string argument inside an
+// attribute's argument list, so that `)` and `,` within the quotes
+// don't affect the enclosing lexAttribute scan. It reports whether the
+// string was properly terminated.
+func (l *lexer) skipAttributeString() bool {
+	for {
+		if l.pos >= len(l.input) || l.peek() == '\n' {
+			return false
+		}
+		r := l.advance()
+		if r == '"' {
+			return true
+		}
+		if r == '\\' && l.peek() == '"' {
+			l.advance()
+		}
+	}
+}
+
+// ParseAttribute extracts the name and value from an ATTRIBUTE token's
+// raw text, e.g. `help("bytes transferred")` becomes ("help", "bytes
+// transferred", true). It only understands the single
+// quoted-string-argument form used by metric attributes like
+// @help(...) and @unit(...); other argument forms (a bare name, a
+// key=value pair, an empty list) aren't metric attributes and report
+// ok==false.
+func ParseAttribute(text string) (name, value string, ok bool) {
+	paren := strings.IndexByte(text, '(')
+	if paren < 0 || !strings.HasSuffix(text, ")") {
+		return "", "", false
+	}
+	arg := text[paren+1 : len(text)-1]
+	unquoted, err := strconv.Unquote(arg)
+	if err != nil {
+		return "", "", false
+	}
+	return text[:paren], unquoted, true
+}
+
+func (l *lexer) lexString(start int) token {
+	var text []rune
+	for {
+		if l.pos >= len(l.input) || l.peek() == '\n' {
+			return l.invalid(
+				fmt.Sprintf("Unterminated quoted string: %s", strconv.Quote(string(l.input[start:l.pos]))),
+				start, l.pos-1)
+		}
+		r := l.advance()
+		if r == '"' {
+			return l.token(STRING, string(text), start, l.pos-1)
+		}
+		if r == '\\' {
+			decoded, tok, ok := l.lexStringEscape(start)
+			if !ok {
+				return tok
+			}
+			text = append(text, decoded...)
+			continue
+		}
+		text = append(text, r)
+	}
+}
+
+// lexStringEscape decodes the escape sequence following a backslash
+// already consumed by the caller inside a quoted string starting at
+// start. On success it returns the decoded runes and ok==true; on
+// failure it returns an INVALID token and ok==false.
+func (l *lexer) lexStringEscape(start int) (decoded []rune, errTok token, ok bool) {
+	switch l.peek() {
+	case '"':
+		l.advance()
+		return []rune{'"'}, token{}, true
+	case '\\':
+		l.advance()
+		return []rune{'\\'}, token{}, true
+	case 'n':
+		l.advance()
+		return []rune{'\n'}, token{}, true
+	case 't':
+		l.advance()
+		return []rune{'\t'}, token{}, true
+	case 'r':
+		l.advance()
+		return []rune{'\r'}, token{}, true
+	case 'x':
+		l.advance()
+		return l.lexHexEscape(start, "x", "hex", 2)
+	case 'u':
+		l.advance()
+		return l.lexHexEscape(start, "u", "unicode", 4)
+	case 'U':
+		l.advance()
+		return l.lexHexEscape(start, "U", "unicode", 8)
+	}
+	return []rune{'\\'}, token{}, true
+}
+
+// lexHexEscape decodes the n hex digits following a `\x`/`\u`/`\U`
+// marker (already consumed) into a single rune. On a malformed escape
+// it returns an INVALID token describing the offending literal, quoted
+// as it appeared in the source, e.g. "Invalid hex escape: \xZZ".
+func (l *lexer) lexHexEscape(start int, marker, kindName string, n int) ([]rune, token, bool) {
+	digitsStart := l.pos
+	val := 0
+	valid := true
+	for i := 0; i < n; i++ {
+		c := l.peek()
+		if c == -1 || c == '\n' {
+			valid = false
+			break
+		}
+		l.advance()
+		d, isHex := hexDigitValue(c)
+		if !isHex {
+			valid = false
+			continue
+		}
+		if valid {
+			val = val*16 + d
+		}
+	}
+	if !valid {
+		return nil, l.invalid(
+			fmt.Sprintf("Invalid %s escape: \\%s%s", kindName, marker, string(l.input[digitsStart:l.pos])),
+			start, l.pos-1), false
+	}
+	return []rune{rune(val)}, token{}, true
+}
+
+func (l *lexer) lexRegex(start int) token {
+	var text []rune
+	for {
+		if l.pos >= len(l.input) || l.peek() == '\n' {
+			return l.invalid(
+				fmt.Sprintf("Unterminated regular expression: %s", strconv.Quote(string(l.input[start:l.pos]))),
+				start, l.pos-1)
+		}
+		r := l.advance()
+		if r == '/' {
+			return l.token(REGEX, string(text), start, l.pos-1)
+		}
+		if r == '\\' && l.peek() == '/' {
+			l.advance()
+			text = append(text, '/')
+			continue
+		}
+		text = append(text, r)
+	}
+}
+
+// lexLineComment scans a `#`-to-end-of-line comment beginning at start,
+// where input[start] is the unconsumed '#'. The returned token's text is
+// the comment body, without the leading '#'.
+func (l *lexer) lexLineComment(start int) token {
+	l.advance() // '#'
+	bodyStart := l.pos
+	for l.pos < len(l.input) && l.peek() != '\n' {
+		l.advance()
+	}
+	return l.token(COMMENT, string(l.input[bodyStart:l.pos]), start, l.pos-1)
+}
+
+// lexBlockComment scans a `/* ... */` comment beginning at start, where
+// input[start:start+2] is the unconsumed "/*". Unlike a line comment, a
+// block comment may span multiple lines. The returned token's text is
+// the comment body, without the surrounding "/*" and "*/".
+func (l *lexer) lexBlockComment(start int) token {
+	l.advance() // '/'
+	l.advance() // '*'
+	bodyStart := l.pos
+	for {
+		if l.pos >= len(l.input) {
+			return l.invalid(
+				fmt.Sprintf("Unterminated block comment: %s", strconv.Quote(string(l.input[start:l.pos]))),
+				start, l.pos-1)
+		}
+		r := l.advance()
+		if r == '*' && l.peek() == '/' {
+			body := string(l.input[bodyStart : l.pos-1])
+			l.advance() // '/'
+			return l.token(COMMENT, body, start, l.pos-1)
+		}
+	}
+}
+
+// DocComment reports the doc comment attached to the metric declaration
+// keyword at tokens[i] (COUNTER, GAUGE, or HISTOGRAM): the text of a
+// COMMENT token immediately before it in tokens, sitting on the line
+// directly above the declaration, with its leading and trailing
+// whitespace trimmed. It is the caller's job to feed it a token stream
+// scanned with keepComments set. ok is false if tokens[i] isn't a
+// metric declaration keyword, or there is no such comment.
+func DocComment(tokens []token, i int) (text string, ok bool) {
+	switch tokens[i].kind {
+	case COUNTER, GAUGE, HISTOGRAM:
+	default:
+		return "", false
+	}
+	if i == 0 || tokens[i-1].kind != COMMENT {
+		return "", false
+	}
+	comment := tokens[i-1]
+	// comment.pos.line is where the comment starts, which for a
+	// multi-line block comment is not the line the declaration needs to
+	// sit directly below; count the newlines in its body to find the
+	// line its closing "*/" (or, for a line comment, its only line)
+	// ends on.
+	commentEndLine := comment.pos.line + strings.Count(comment.text, "\n")
+	if tokens[i].pos.line != commentEndLine+1 {
+		return "", false
+	}
+	return strings.TrimSpace(comment.text), true
+}
@@ -11,20 +11,22 @@ import (
 )
 
 type lexerTest struct {
-	name   string
-	input  string
-	tokens []token
+	name         string
+	input        string
+	tokens       []token
+	errs         []string
+	keepComments bool
 }
 
 var lexerTests = []lexerTest{
 	{"empty", "", []token{
-		token{EOF, "", position{"empty", 0, 0, 0}}}},
+		token{EOF, "", position{"empty", 0, 0, 0}}}, nil, false},
 	{"spaces", " \t\n", []token{
-		token{EOF, "", position{"spaces", 1, 0, 0}}}},
+		token{EOF, "", position{"spaces", 1, 0, 0}}}, nil, false},
 	{"comment", "# comment", []token{
-		token{EOF, "", position{"comment", 0, 9, 9}}}},
+		token{EOF, "", position{"comment", 0, 9, 9}}}, nil, false},
 	{"comment not at col 1", "  # comment", []token{
-		token{EOF, "", position{"comment not at col 1", 0, 11, 11}}}},
+		token{EOF, "", position{"comment not at col 1", 0, 11, 11}}}, nil, false},
 	{"punctuation", "{}()[],", []token{
 		token{LCURLY, "{", position{"punctuation", 0, 0, 0}},
 		token{RCURLY, "}", position{"punctuation", 0, 1, 1}},
@@ -33,7 +35,7 @@ var lexerTests = []lexerTest{
 		token{LSQUARE, "[", position{"punctuation", 0, 4, 4}},
 		token{RSQUARE, "]", position{"punctuation", 0, 5, 5}},
 		token{COMMA, ",", position{"punctuation", 0, 6, 6}},
-		token{EOF, "", position{"punctuation", 0, 7, 7}}}},
+		token{EOF, "", position{"punctuation", 0, 7, 7}}}, nil, false},
 	{"operators", "- + = ++ += < > <= >= == !=", []token{
 		token{MINUS, "-", position{"operators", 0, 0, 0}},
 		token{PLUS, "+", position{"operators", 0, 2, 2}},
@@ -46,7 +48,7 @@ var lexerTests = []lexerTest{
 		token{GE, ">=", position{"operators", 0, 19, 20}},
 		token{EQ, "==", position{"operators", 0, 22, 23}},
 		token{NE, "!=", position{"operators", 0, 25, 26}},
-		token{EOF, "", position{"operators", 0, 27, 27}}}},
+		token{EOF, "", position{"operators", 0, 27, 27}}}, nil, false},
 	{"keywords",
 		"counter\ngauge\nas\nby\nhidden\ndef\nnext\nconst\n", []token{
 			token{COUNTER, "counter", position{"keywords", 0, 0, 6}},
@@ -57,53 +59,130 @@ var lexerTests = []lexerTest{
 			token{DEF, "def", position{"keywords", 5, 0, 2}},
 			token{NEXT, "next", position{"keywords", 6, 0, 3}},
 			token{CONST, "const", position{"keywords", 7, 0, 4}},
-			token{EOF, "", position{"keywords", 8, 0, 0}}}},
+			token{EOF, "", position{"keywords", 8, 0, 0}}}, nil, false},
 	{"builtins",
 		"strptime\ntimestamp\ntolower\nlen\n", []token{
 			token{BUILTIN, "strptime", position{"builtins", 0, 0, 7}},
 			token{BUILTIN, "timestamp", position{"builtins", 1, 0, 8}},
 			token{BUILTIN, "tolower", position{"builtins", 2, 0, 6}},
 			token{BUILTIN, "len", position{"builtins", 3, 0, 2}},
-			token{EOF, "", position{"builtins", 4, 0, 0}}}},
+			token{EOF, "", position{"builtins", 4, 0, 0}}}, nil, false},
+	{"histogram keyword", "histogram\n", []token{
+		token{HISTOGRAM, "histogram", position{"histogram keyword", 0, 0, 8}},
+		token{EOF, "", position{"histogram keyword", 1, 0, 0}}}, nil, false},
+	{"buckets outside a histogram header is an identifier", "buckets\n", []token{
+		token{ID, "buckets", position{"buckets outside a histogram header is an identifier", 0, 0, 6}},
+		token{EOF, "", position{"buckets outside a histogram header is an identifier", 1, 0, 0}}}, nil, false},
+	{"histogram declaration with numeric bucket list",
+		"histogram http_latency by method buckets 5, 10, 50, 100, 500\n", []token{
+			token{HISTOGRAM, "histogram", position{"histogram declaration with numeric bucket list", 0, 0, 8}},
+			token{ID, "http_latency", position{"histogram declaration with numeric bucket list", 0, 10, 21}},
+			token{BY, "by", position{"histogram declaration with numeric bucket list", 0, 23, 24}},
+			token{ID, "method", position{"histogram declaration with numeric bucket list", 0, 26, 31}},
+			token{BUCKETS, "buckets", position{"histogram declaration with numeric bucket list", 0, 33, 39}},
+			token{NUMERIC, "5", position{"histogram declaration with numeric bucket list", 0, 41, 41}},
+			token{COMMA, ",", position{"histogram declaration with numeric bucket list", 0, 42, 42}},
+			token{NUMERIC, "10", position{"histogram declaration with numeric bucket list", 0, 44, 45}},
+			token{COMMA, ",", position{"histogram declaration with numeric bucket list", 0, 46, 46}},
+			token{NUMERIC, "50", position{"histogram declaration with numeric bucket list", 0, 48, 49}},
+			token{COMMA, ",", position{"histogram declaration with numeric bucket list", 0, 50, 50}},
+			token{NUMERIC, "100", position{"histogram declaration with numeric bucket list", 0, 52, 54}},
+			token{COMMA, ",", position{"histogram declaration with numeric bucket list", 0, 55, 55}},
+			token{NUMERIC, "500", position{"histogram declaration with numeric bucket list", 0, 57, 59}},
+			token{EOF, "", position{"histogram declaration with numeric bucket list", 1, 0, 0}}}, nil, false},
+	{"buckets on the line after a histogram header is an identifier",
+		"histogram foo\nbuckets\n", []token{
+			token{HISTOGRAM, "histogram", position{"buckets on the line after a histogram header is an identifier", 0, 0, 8}},
+			token{ID, "foo", position{"buckets on the line after a histogram header is an identifier", 0, 10, 12}},
+			token{ID, "buckets", position{"buckets on the line after a histogram header is an identifier", 1, 0, 6}},
+			token{EOF, "", position{"buckets on the line after a histogram header is an identifier", 2, 0, 0}}}, nil, false},
 	{"numeric", "1 23", []token{
 		token{NUMERIC, "1", position{"numeric", 0, 0, 0}},
 		token{NUMERIC, "23", position{"numeric", 0, 2, 3}},
-		token{EOF, "", position{"numeric", 0, 4, 4}}}},
+		token{EOF, "", position{"numeric", 0, 4, 4}}}, nil, false},
+	{"numeric with underscore separators", "1_000_000", []token{
+		token{NUMERIC, "1_000_000", position{"numeric with underscore separators", 0, 0, 8}},
+		token{EOF, "", position{"numeric with underscore separators", 0, 9, 9}}}, nil, false},
+	{"hex literal", "0x1f", []token{
+		token{NUMERIC, "0x1f", position{"hex literal", 0, 0, 3}},
+		token{EOF, "", position{"hex literal", 0, 4, 4}}}, nil, false},
+	{"octal literal", "0o17", []token{
+		token{NUMERIC, "0o17", position{"octal literal", 0, 0, 3}},
+		token{EOF, "", position{"octal literal", 0, 4, 4}}}, nil, false},
+	{"binary literal", "0b1010", []token{
+		token{NUMERIC, "0b1010", position{"binary literal", 0, 0, 5}},
+		token{EOF, "", position{"binary literal", 0, 6, 6}}}, nil, false},
+	{"float literal", "1.5", []token{
+		token{FLOAT, "1.5", position{"float literal", 0, 0, 2}},
+		token{EOF, "", position{"float literal", 0, 3, 3}}}, nil, false},
+	{"float literal with exponent", "3e-2", []token{
+		token{FLOAT, "3e-2", position{"float literal with exponent", 0, 0, 3}},
+		token{EOF, "", position{"float literal with exponent", 0, 4, 4}}}, nil, false},
+	{"float literal with leading dot", ".25", []token{
+		token{FLOAT, ".25", position{"float literal with leading dot", 0, 0, 2}},
+		token{EOF, "", position{"float literal with leading dot", 0, 3, 3}}}, nil, false},
 	{"identifier", "a be foo\nquux line-count", []token{
 		token{ID, "a", position{"identifier", 0, 0, 0}},
 		token{ID, "be", position{"identifier", 0, 2, 3}},
 		token{ID, "foo", position{"identifier", 0, 5, 7}},
 		token{ID, "quux", position{"identifier", 1, 0, 3}},
 		token{ID, "line-count", position{"identifier", 1, 5, 14}},
-		token{EOF, "", position{"identifier", 1, 15, 15}}}},
+		token{EOF, "", position{"identifier", 1, 15, 15}}}, nil, false},
 	{"regex", "/asdf/", []token{
 		token{REGEX, "asdf", position{"regex", 0, 0, 5}},
-		token{EOF, "", position{"regex", 0, 6, 6}}}},
+		token{EOF, "", position{"regex", 0, 6, 6}}}, nil, false},
 	{"regex with escape", `/asdf\//`, []token{
 		token{REGEX, `asdf/`, position{"regex with escape", 0, 0, 7}},
-		token{EOF, "", position{"regex with escape", 0, 8, 8}}}},
+		token{EOF, "", position{"regex with escape", 0, 8, 8}}}, nil, false},
 	{"regex with escape and special char", `/foo\d\//`, []token{
 		token{REGEX, `foo\d/`, position{"regex with escape and special char", 0, 0, 8}},
-		token{EOF, "", position{"regex with escape and special char", 0, 9, 9}}}},
+		token{EOF, "", position{"regex with escape and special char", 0, 9, 9}}}, nil, false},
 	{"capref", "$foo", []token{
 		token{CAPREF, "foo", position{"capref", 0, 0, 3}},
-		token{EOF, "", position{"capref", 0, 4, 4}}}},
+		token{EOF, "", position{"capref", 0, 4, 4}}}, nil, false},
 	{"numerical capref", "$1", []token{
 		token{CAPREF, "1", position{"numerical capref", 0, 0, 1}},
-		token{EOF, "", position{"numerical capref", 0, 2, 2}}}},
+		token{EOF, "", position{"numerical capref", 0, 2, 2}}}, nil, false},
 	{"capref with trailing punc", "$foo,", []token{
 		token{CAPREF, "foo", position{"capref with trailing punc", 0, 0, 3}},
 		token{COMMA, ",", position{"capref with trailing punc", 0, 4, 4}},
-		token{EOF, "", position{"capref with trailing punc", 0, 5, 5}}}},
+		token{EOF, "", position{"capref with trailing punc", 0, 5, 5}}}, nil, false},
 	{"quoted string", `"asdf"`, []token{
 		token{STRING, `asdf`, position{"quoted string", 0, 0, 5}},
-		token{EOF, "", position{"quoted string", 0, 6, 6}}}},
+		token{EOF, "", position{"quoted string", 0, 6, 6}}}, nil, false},
 	{"escaped quote in quoted string", `"\""`, []token{
 		token{STRING, `"`, position{"escaped quote in quoted string", 0, 0, 3}},
-		token{EOF, "", position{"escaped quote in quoted string", 0, 4, 4}}}},
+		token{EOF, "", position{"escaped quote in quoted string", 0, 4, 4}}}, nil, false},
+	{"common escapes in quoted string", `"\n\t\r\\"`, []token{
+		token{STRING, "\n\t\r\\", position{"common escapes in quoted string", 0, 0, 9}},
+		token{EOF, "", position{"common escapes in quoted string", 0, 10, 10}}}, nil, false},
+	{"hex escape in quoted string", `"\x41"`, []token{
+		token{STRING, "A", position{"hex escape in quoted string", 0, 0, 5}},
+		token{EOF, "", position{"hex escape in quoted string", 0, 6, 6}}}, nil, false},
+	{"unicode escape in quoted string", `"\u00e9"`, []token{
+		token{STRING, "\u00e9", position{"unicode escape in quoted string", 0, 0, 7}},
+		token{EOF, "", position{"unicode escape in quoted string", 0, 8, 8}}}, nil, false},
+	{"long unicode escape in quoted string", `"\U0001F600"`, []token{
+		token{STRING, "\U0001F600", position{"long unicode escape in quoted string", 0, 0, 11}},
+		token{EOF, "", position{"long unicode escape in quoted string", 0, 12, 12}}}, nil, false},
 	{"decorator", `@foo`, []token{
 		token{DECO, "foo", position{"decorator", 0, 0, 3}},
-		token{EOF, "", position{"decorator", 0, 4, 4}}}},
+		token{EOF, "", position{"decorator", 0, 4, 4}}}, nil, false},
+	{"empty attribute", `@foo()`, []token{
+		token{ATTRIBUTE, "foo()", position{"empty attribute", 0, 0, 5}},
+		token{EOF, "", position{"empty attribute", 0, 6, 6}}}, nil, false},
+	{"attribute with bare arg", `@foo(a)`, []token{
+		token{ATTRIBUTE, "foo(a)", position{"attribute with bare arg", 0, 0, 6}},
+		token{EOF, "", position{"attribute with bare arg", 0, 7, 7}}}, nil, false},
+	{"attribute with key=value arg", `@foo(a=b)`, []token{
+		token{ATTRIBUTE, "foo(a=b)", position{"attribute with key=value arg", 0, 0, 8}},
+		token{EOF, "", position{"attribute with key=value arg", 0, 9, 9}}}, nil, false},
+	{"attribute with leading comma", `@foo(,a=b)`, []token{
+		token{ATTRIBUTE, "foo(,a=b)", position{"attribute with leading comma", 0, 0, 9}},
+		token{EOF, "", position{"attribute with leading comma", 0, 10, 10}}}, nil, false},
+	{"help attribute with quoted string arg", `@help("bytes transferred")`, []token{
+		token{ATTRIBUTE, `help("bytes transferred")`, position{"help attribute with quoted string arg", 0, 0, 25}},
+		token{EOF, "", position{"help attribute with quoted string arg", 0, 26, 26}}}, nil, false},
 	{"large program",
 		"/(?P<date>[[:digit:]-\\/ ])/ {\n" +
 			"  strptime($date, \"%Y/%m/%d %H:%M:%S\")\n" +
@@ -120,42 +199,150 @@ var lexerTests = []lexerTest{
 			token{ID, "foo", position{"large program", 2, 2, 4}},
 			token{INC, "++", position{"large program", 2, 5, 6}},
 			token{RCURLY, "}", position{"large program", 3, 0, 0}},
-			token{EOF, "", position{"large program", 3, 1, 1}}}},
+			token{EOF, "", position{"large program", 3, 1, 1}}}, nil, false},
 	{"linecount",
 		"# comment\n" +
 			"# blank line\n" +
 			"\n" +
 			"foo", []token{
 			token{ID, "foo", position{"linecount", 3, 0, 2}},
-			token{EOF, "", position{"linecount", 3, 3, 3}}}},
+			token{EOF, "", position{"linecount", 3, 3, 3}}}, nil, false},
 	// errors
+	//
+	// A lexical error never stops the scan or surfaces as a token: it's
+	// recorded in the lexer's errs and scanning resumes past it, so these
+	// cases assert on both the (still complete, EOF-terminated) token
+	// stream and the accumulated error messages.
 	{"unexpected char", "?", []token{
-		token{INVALID, "Unexpected input: '?'", position{"unexpected char", 0, 0, 0}}}},
+		token{EOF, "", position{"unexpected char", 0, 1, 1}}},
+		[]string{`unexpected char:1:1-1: Unexpected input: '?'`}, false},
 	{"unterminated regex", "/foo\n", []token{
-		token{INVALID, "Unterminated regular expression: \"/foo\"", position{"unterminated regex", 0, 0, 3}}}},
+		token{EOF, "", position{"unterminated regex", 1, 0, 0}}},
+		[]string{`unterminated regex:1:1-4: Unterminated regular expression: "/foo"`}, false},
 	{"unterminated quoted string", "\"foo\n", []token{
-		token{INVALID, "Unterminated quoted string: \"\\\"foo\"", position{"unterminated quoted string", 0, 0, 3}}}},
+		token{EOF, "", position{"unterminated quoted string", 1, 0, 0}}},
+		[]string{`unterminated quoted string:1:1-4: Unterminated quoted string: "\"foo"`}, false},
+	{"invalid hex escape in quoted string", `"\xZZ"`, []token{
+		token{EOF, "", position{"invalid hex escape in quoted string", 0, 6, 6}}},
+		[]string{
+			`invalid hex escape in quoted string:1:1-5: Invalid hex escape: \xZZ`,
+			`invalid hex escape in quoted string:1:6-6: Unterminated quoted string: "\""`,
+		}, false},
+	{"invalid hex literal", "0x", []token{
+		token{EOF, "", position{"invalid hex literal", 0, 2, 2}}},
+		[]string{`invalid hex literal:1:1-2: Invalid hex literal: 0x`}, false},
+	{"unterminated attribute", "@foo(a\n", []token{
+		token{EOF, "", position{"unterminated attribute", 1, 0, 0}}},
+		[]string{`unterminated attribute:1:1-6: Unterminated attribute: "@foo(a"`}, false},
+	{"multiple errors in one input", "?\n?\n", []token{
+		token{EOF, "", position{"multiple errors in one input", 2, 0, 0}}},
+		[]string{
+			`multiple errors in one input:1:1-1: Unexpected input: '?'`,
+			`multiple errors in one input:2:1-1: Unexpected input: '?'`,
+		}, false},
+	// block comments
+	{"empty block comment", "/**/", []token{
+		token{EOF, "", position{"empty block comment", 0, 4, 4}}}, nil, false},
+	{"multi-line block comment", "/*one\ntwo*/foo", []token{
+		token{ID, "foo", position{"multi-line block comment", 1, 5, 7}},
+		token{EOF, "", position{"multi-line block comment", 1, 8, 8}}}, nil, false},
+	{"unterminated block comment", "/* foo", []token{
+		token{EOF, "", position{"unterminated block comment", 0, 6, 6}}},
+		[]string{`unterminated block comment:1:1-6: Unterminated block comment: "/* foo"`}, false},
+	{"doc comment then counter", "# a doc comment\ncounter\n", []token{
+		token{COMMENT, " a doc comment", position{"doc comment then counter", 0, 0, 14}},
+		token{COUNTER, "counter", position{"doc comment then counter", 1, 0, 6}},
+		token{EOF, "", position{"doc comment then counter", 2, 0, 0}}}, nil, true},
 }
 
-// collect gathers the emitted items into a slice.
-func collect(t *lexerTest) (tokens []token) {
+// collect gathers the emitted tokens into a slice, along with any
+// lexical errors the lexer accumulated along the way.
+func collect(t *lexerTest) (tokens []token, errs []string) {
 	l := newLexer(t.name, strings.NewReader(t.input))
+	l.keepComments = t.keepComments
 	for {
 		token := l.nextToken()
 		tokens = append(tokens, token)
-		if token.kind == EOF || token.kind == INVALID {
+		if token.kind == EOF {
 			break
 		}
 	}
+	for _, e := range l.errs {
+		errs = append(errs, e.Error())
+	}
 	return
 }
 
 func TestLex(t *testing.T) {
 	for _, test := range lexerTests {
-		tokens := collect(&test)
+		tokens, errs := collect(&test)
 		diff := pretty.Compare(test.tokens, tokens)
 		if len(diff) > 0 {
 			t.Errorf("%s tokens didn't match:\n%s:", test.name, diff)
 		}
+		diff = pretty.Compare(test.errs, errs)
+		if len(diff) > 0 {
+			t.Errorf("%s errors didn't match:\n%s:", test.name, diff)
+		}
+	}
+}
+
+var parseAttributeTests = []struct {
+	text  string
+	name  string
+	value string
+	ok    bool
+}{
+	{`help("bytes transferred")`, "help", "bytes transferred", true},
+	{`unit("seconds")`, "unit", "seconds", true},
+	{`help("escaped \"quote\"")`, "help", `escaped "quote"`, true},
+	{"foo()", "", "", false},
+	{"foo(a)", "", "", false},
+	{"foo(a=b)", "", "", false},
+	{"foo(,a=b)", "", "", false},
+}
+
+func TestParseAttribute(t *testing.T) {
+	for _, test := range parseAttributeTests {
+		name, value, ok := ParseAttribute(test.text)
+		if ok != test.ok || name != test.name || value != test.value {
+			t.Errorf("ParseAttribute(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				test.text, name, value, ok, test.name, test.value, test.ok)
+		}
+	}
+}
+
+var docCommentTests = []struct {
+	name  string
+	input string
+	text  string
+	ok    bool
+}{
+	{"line comment directly above a counter",
+		"# a doc comment\ncounter\n", "a doc comment", true},
+	{"block comment directly above a gauge",
+		"/* a doc comment */\ngauge\n", "a doc comment", true},
+	{"comment directly above a histogram",
+		"# a doc comment\nhistogram\n", "a doc comment", true},
+	{"blank line between comment and declaration",
+		"# a doc comment\n\ncounter\n", "", false},
+	{"no comment above the declaration",
+		"counter\n", "", false},
+	{"comment above a non-declaration",
+		"# a doc comment\nfoo\n", "", false},
+	{"multi-line block comment directly above a counter",
+		"/* multi\nline comment */\ncounter\n", "multi\nline comment", true},
+	{"blank line between a multi-line block comment and declaration",
+		"/* multi\nline comment */\n\ncounter\n", "", false},
+}
+
+func TestDocComment(t *testing.T) {
+	for _, test := range docCommentTests {
+		lt := lexerTest{name: test.name, input: test.input, keepComments: true}
+		tokens, _ := collect(&lt)
+		text, ok := DocComment(tokens, len(tokens)-2)
+		if ok != test.ok || text != test.text {
+			t.Errorf("%s: DocComment = (%q, %v), want (%q, %v)", test.name, text, ok, test.text, test.ok)
+		}
 	}
 }
@@ -0,0 +1,112 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package vm
+
+import "fmt"
+
+// Pos is an opaque handle to an offset within a FileSet, resolved back
+// to a file, line, and column via FileSet.Position. It plays the same
+// role as go/token.Pos.
+type Pos int
+
+// File tracks the line boundaries of a single named source added to a
+// FileSet, so offsets within it can be resolved to a line and column.
+type File struct {
+	name  string
+	base  int // offset of this file's first rune within the owning FileSet
+	size  int
+	lines []int // offsets, relative to base, of the start of each line
+}
+
+// addLine records that a new line starts at the given offset, relative
+// to the start of the file. Lines must be added in increasing order;
+// out-of-order or repeat offsets are ignored.
+func (f *File) addLine(offset int) {
+	if n := len(f.lines); n == 0 || f.lines[n-1] < offset {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+// Pos returns the Pos for the given offset, relative to the start of
+// the file.
+func (f *File) Pos(offset int) Pos {
+	return Pos(f.base + offset)
+}
+
+// position resolves an offset relative to the start of the file into
+// its 0-indexed line and column.
+func (f *File) position(offset int) (line, col int) {
+	lo, hi := 0, len(f.lines)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if f.lines[mid] <= offset {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	line = lo - 1
+	col = offset - f.lines[line]
+	return line, col
+}
+
+// FileSet maps the Pos handles of every File added to it back to that
+// file's name, line, and column, so a lexer or parser can carry a
+// lightweight Pos around and only resolve it to something
+// human-readable on demand.
+type FileSet struct {
+	base  int
+	files []*File
+}
+
+// newFileSet creates an empty FileSet.
+func newFileSet() *FileSet {
+	return &FileSet{base: 1}
+}
+
+// AddFile registers a new file of the given name and size with the
+// FileSet, returning a File the caller uses to record line boundaries
+// as it scans and to mint Pos values for that file's offsets.
+func (s *FileSet) AddFile(name string, size int) *File {
+	f := &File{name: name, base: s.base, size: size, lines: []int{0}}
+	s.files = append(s.files, f)
+	s.base += size + 1
+	return f
+}
+
+// file returns the File that p falls within, or nil if none does.
+func (s *FileSet) file(p Pos) *File {
+	for _, f := range s.files {
+		if int(p) >= f.base && int(p) <= f.base+f.size {
+			return f
+		}
+	}
+	return nil
+}
+
+// position describes the location of a token in a program source, as an
+// inclusive column range on a single line: endcol is the column of the
+// token's last rune.
+type position struct {
+	filename string
+	line     int
+	startcol int
+	endcol   int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%s:%d:%d-%d", p.filename, p.line+1, p.startcol+1, p.endcol+1)
+}
+
+// Position resolves a pair of Pos handles, marking the start and end of
+// a token within the same file, into a position.
+func (s *FileSet) Position(start, end Pos) position {
+	f := s.file(start)
+	if f == nil {
+		return position{}
+	}
+	line, startcol := f.position(int(start) - f.base)
+	_, endcol := f.position(int(end) - f.base)
+	return position{f.name, line, startcol, endcol}
+}
@@ -0,0 +1,89 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+// This file is available under the Apache license.
+
+package vm
+
+// tokenKind identifies the type of lexical token.
+type tokenKind int
+
+const (
+	EOF tokenKind = iota
+	INVALID
+
+	LCURLY
+	RCURLY
+	LPAREN
+	RPAREN
+	LSQUARE
+	RSQUARE
+	COMMA
+
+	MINUS
+	PLUS
+	ASSIGN
+	INC
+	ADD_ASSIGN
+	LT
+	GT
+	LE
+	GE
+	EQ
+	NE
+
+	COUNTER
+	GAUGE
+	HISTOGRAM
+	AS
+	BY
+	HIDDEN
+	DEF
+	NEXT
+	CONST
+	BUCKETS
+
+	BUILTIN
+	NUMERIC
+	FLOAT
+	ID
+	REGEX
+	CAPREF
+	STRING
+	DECO
+	ATTRIBUTE
+	COMMENT
+)
+
+// keywords are reserved words with a dedicated token kind.
+//
+// "buckets" is a contextual keyword: it only lexes as BUCKETS on the
+// line that opens a histogram declaration (see lexer.inHistogramHeader),
+// so it remains usable as an ordinary identifier, label, or variable
+// name everywhere else.
+var keywords = map[string]tokenKind{
+	"counter":   COUNTER,
+	"gauge":     GAUGE,
+	"histogram": HISTOGRAM,
+	"as":        AS,
+	"by":        BY,
+	"hidden":    HIDDEN,
+	"def":       DEF,
+	"next":      NEXT,
+	"const":     CONST,
+	"buckets":   BUCKETS,
+}
+
+// builtins are the names of functions available to mtail programs.
+var builtins = map[string]bool{
+	"strptime":  true,
+	"timestamp": true,
+	"tolower":   true,
+	"len":       true,
+}
+
+// token is a lexical token: its kind, the literal text it was scanned
+// from, and the position of that text in the source.
+type token struct {
+	kind tokenKind
+	text string
+	pos  position
+}